@@ -0,0 +1,89 @@
+package http2
+
+import (
+	"sync"
+	"time"
+)
+
+// closedStreamLRUSize bounds how many recently-closed stream IDs a
+// connection remembers for the grace-window checks in transition.
+const closedStreamLRUSize = 256
+
+// defaultClosedStreamGrace is how long after a stream closes that we
+// tolerate the trailing frames RFC 7540 allows a peer to still send for
+// it (WINDOW_UPDATE/RST_STREAM racing our END_STREAM or RST_STREAM).
+const defaultClosedStreamGrace = 5 * time.Second
+
+// closedStreamLRU remembers the last N streams to close on a
+// connection, so transition can still find them (and their closedAt
+// timestamp) after conn.removeStream has dropped them from the live
+// stream table.
+type closedStreamLRU struct {
+	mu    sync.Mutex
+	order []uint32
+	byID  map[uint32]*stream
+}
+
+func newClosedStreamLRU() *closedStreamLRU {
+	return &closedStreamLRU{byID: make(map[uint32]*stream)}
+}
+
+func (l *closedStreamLRU) add(s *stream) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, exists := l.byID[s.id]; !exists {
+		l.order = append(l.order, s.id)
+	}
+	l.byID[s.id] = s
+
+	for len(l.order) > closedStreamLRUSize {
+		oldest := l.order[0]
+		l.order = l.order[1:]
+		delete(l.byID, oldest)
+	}
+}
+
+func (l *closedStreamLRU) get(id uint32) (*stream, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.byID[id]
+	return s, ok
+}
+
+// rememberClosed records s as recently closed so that frames arriving
+// for it within conn.ClosedStreamGrace can still be looked up and
+// tolerated instead of killing the connection.
+func (c *Conn) rememberClosed(s *stream) {
+	c.mu.Lock()
+	if c.closedStreamLRU == nil {
+		c.closedStreamLRU = newClosedStreamLRU()
+	}
+	lru := c.closedStreamLRU
+	c.mu.Unlock()
+
+	lru.add(s)
+}
+
+// closedStream looks up a recently closed stream by ID, for frame
+// handling code that needs to tolerate trailing frames per
+// withinClosedGrace.
+func (c *Conn) closedStream(id uint32) (*stream, bool) {
+	c.mu.Lock()
+	lru := c.closedStreamLRU
+	c.mu.Unlock()
+	if lru == nil {
+		return nil, false
+	}
+	return lru.get(id)
+}
+
+// closedStreamGrace returns the configured grace window, or
+// defaultClosedStreamGrace if the connection wasn't configured with
+// one.
+func (c *Conn) closedStreamGrace() time.Duration {
+	if c.ClosedStreamGrace > 0 {
+		return c.ClosedStreamGrace
+	}
+	return defaultClosedStreamGrace
+}
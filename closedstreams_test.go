@@ -0,0 +1,49 @@
+package http2
+
+import "testing"
+
+// TestClosedStreamLRURemembersAndEvicts covers the LRU's basic contract:
+// a remembered stream is found by ID, and once more than
+// closedStreamLRUSize streams have been added the oldest entries fall
+// off rather than growing the map unboundedly.
+func TestClosedStreamLRURemembersAndEvicts(t *testing.T) {
+	lru := newClosedStreamLRU()
+
+	first := newTestStream(1, defaultWeight-1)
+	lru.add(first)
+
+	if got, ok := lru.get(1); !ok || got != first {
+		t.Fatalf("get(1) = %v, %v; want %v, true", got, ok, first)
+	}
+
+	for id := uint32(3); id < 3+2*closedStreamLRUSize; id += 2 {
+		lru.add(newTestStream(id, defaultWeight-1))
+	}
+
+	if _, ok := lru.get(1); ok {
+		t.Fatalf("expected stream 1 to have been evicted after %d more insertions", closedStreamLRUSize)
+	}
+	if len(lru.byID) != closedStreamLRUSize {
+		t.Fatalf("lru holds %d entries, want %d", len(lru.byID), closedStreamLRUSize)
+	}
+}
+
+// TestStreamByIDFallsBackToClosedStream covers the fix for streamByID:
+// once a stream has been forgotten by conn.streams (closed and removed),
+// a frame still targeting its ID must resolve via the closed-stream LRU
+// rather than being treated as referring to an unknown stream.
+func TestStreamByIDFallsBackToClosedStream(t *testing.T) {
+	conn := &Conn{}
+	s := newTestStream(1, defaultWeight-1)
+	s.conn = conn
+	conn.rememberClosed(s)
+
+	got, ok := conn.streamByID(1)
+	if !ok || got != s {
+		t.Fatalf("streamByID(1) = %v, %v; want %v, true", got, ok, s)
+	}
+
+	if _, ok := conn.streamByID(99); ok {
+		t.Fatalf("streamByID(99) reported found for a stream that was never opened or closed")
+	}
+}
@@ -0,0 +1,142 @@
+package http2
+
+import "time"
+
+// timeoutError is returned by stream operations that abort because a
+// read or write deadline elapsed. It implements net.Error so callers can
+// type-assert on Timeout() the same way they would for a net.Conn.
+type timeoutError struct{}
+
+func (*timeoutError) Error() string   { return "http2: stream deadline exceeded" }
+func (*timeoutError) Timeout() bool   { return true }
+func (*timeoutError) Temporary() bool { return true }
+
+// waitWerr waits for the write result of the frame most recently handed
+// to the writer, returning a *timeoutError (and canceling delivery) if
+// the write deadline fires first. It re-reads the current deadline on
+// every iteration, so a concurrent SetWriteDeadline takes effect on this
+// wait immediately rather than only on the next call to write.
+func (s *stream) waitWerr() error {
+	for {
+		timeoutCh, changedCh := s.writeWaitChans()
+		select {
+		case err := <-s.werr:
+			return err
+		case <-timeoutCh:
+			err := &timeoutError{}
+			s.cancel(err)
+			return err
+		case <-changedCh:
+			// Deadline was changed out from under us; loop and
+			// re-evaluate against the new one.
+		}
+	}
+}
+
+// SetWriteDeadline sets the deadline for future calls to write, and for
+// any write already blocked waiting for the stream's write path, for
+// room in its write buffer, or for the result of a queued frame. A write
+// blocked in allocateBytes waiting for peer flow-control window does not
+// observe the deadline. A zero value for t disables the deadline. SetWriteDeadline does not close the
+// stream on expiry; the caller decides whether to give up or reset it.
+// It may be called concurrently with write, and a new deadline may be
+// set while one is already pending.
+func (s *stream) SetWriteDeadline(t time.Time) error {
+	s.deadlineMu.Lock()
+	defer s.deadlineMu.Unlock()
+
+	if s.writeTimer != nil {
+		s.writeTimer.Stop()
+	}
+
+	if t.IsZero() {
+		s.writeTimer = nil
+		s.writeTimerCh = nil
+	} else {
+		ch := make(chan struct{})
+		s.writeTimerCh = ch
+		s.writeTimer = time.AfterFunc(time.Until(t), func() { close(ch) })
+	}
+
+	s.bumpWriteChanged()
+	return nil
+}
+
+// SetReadDeadline sets the deadline for future reads from the stream's
+// inbound pipe, and for any Read already blocked. A zero value for t
+// disables the deadline.
+func (s *stream) SetReadDeadline(t time.Time) error {
+	s.deadlineMu.Lock()
+	defer s.deadlineMu.Unlock()
+
+	if s.readTimer != nil {
+		s.readTimer.Stop()
+	}
+
+	if t.IsZero() {
+		s.readTimer = nil
+		s.readTimerCh = nil
+	} else {
+		ch := make(chan struct{})
+		s.readTimerCh = ch
+		s.readTimer = time.AfterFunc(time.Until(t), func() { close(ch) })
+	}
+
+	s.bumpReadChanged()
+	return nil
+}
+
+// SetDeadline sets both the read and write deadlines.
+func (s *stream) SetDeadline(t time.Time) error {
+	if err := s.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return s.SetWriteDeadline(t)
+}
+
+// bumpWriteChanged wakes up anything blocked in writeWaitChans's
+// changedCh on the previous deadline, so it re-reads the new one.
+// Callers must hold deadlineMu.
+func (s *stream) bumpWriteChanged() {
+	if s.writeChangedCh != nil {
+		close(s.writeChangedCh)
+	}
+	s.writeChangedCh = make(chan struct{})
+}
+
+// bumpReadChanged is bumpWriteChanged's read-side counterpart. Callers
+// must hold deadlineMu.
+func (s *stream) bumpReadChanged() {
+	if s.readChangedCh != nil {
+		close(s.readChangedCh)
+	}
+	s.readChangedCh = make(chan struct{})
+}
+
+// writeWaitChans returns the channel that closes when the current write
+// deadline elapses (nil if none is set) together with a channel that
+// closes the moment either one changes, so a blocked waiter can loop and
+// pick up the new deadline instead of being stuck on a stale snapshot.
+// changed is lazily created here if no deadline has ever been set yet,
+// so a waiter blocking before the first SetWriteDeadline call still
+// shares the same channel SetWriteDeadline will close, rather than
+// seeing a nil channel that would block forever.
+func (s *stream) writeWaitChans() (timeout, changed <-chan struct{}) {
+	s.deadlineMu.Lock()
+	defer s.deadlineMu.Unlock()
+	if s.writeChangedCh == nil {
+		s.writeChangedCh = make(chan struct{})
+	}
+	return s.writeTimerCh, s.writeChangedCh
+}
+
+// readWaitChans is writeWaitChans's read-side counterpart, for the
+// stream's Read implementation to select on alongside its inbound pipe.
+func (s *stream) readWaitChans() (timeout, changed <-chan struct{}) {
+	s.deadlineMu.Lock()
+	defer s.deadlineMu.Unlock()
+	if s.readChangedCh == nil {
+		s.readChangedCh = make(chan struct{})
+	}
+	return s.readTimerCh, s.readChangedCh
+}
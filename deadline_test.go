@@ -0,0 +1,66 @@
+package http2
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestDeadlineStream() *stream {
+	s := newTestStream(1, defaultWeight-1)
+	s.conn = &Conn{closeCh: make(chan struct{})}
+	s.closeCh = make(chan struct{})
+	return s
+}
+
+// TestSetReadDeadlineWakesBlockedRead is the regression the maintainer
+// asked for: setting a read deadline for the very first time, after a
+// Read is already blocked, must cause that Read to time out -- not just
+// affect the next call.
+func TestSetReadDeadlineWakesBlockedRead(t *testing.T) {
+	s := newTestDeadlineStream()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Read(make([]byte, 8))
+		done <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond) // let Read block on the empty pipe
+	s.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+
+	select {
+	case err := <-done:
+		if te, ok := err.(*timeoutError); !ok || !te.Timeout() {
+			t.Fatalf("want *timeoutError, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocked Read never observed the concurrently-set deadline")
+	}
+}
+
+// TestSetWriteDeadlineWakesBlockedWrite covers the same fix on the write
+// side: write is blocked in reserveWriteBuffer waiting for its write
+// buffer to drain (reserveWriteBuffer selects on writeWaitChans), and a
+// deadline set after the call started must still abort it.
+func TestSetWriteDeadlineWakesBlockedWrite(t *testing.T) {
+	s := newTestDeadlineStream()
+	s.conn.StreamWriteBufferSize = 10
+	s.writeBufLen = 10 // buffer already full, so reserveWriteBuffer blocks
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.reserveWriteBuffer(5)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	s.SetWriteDeadline(time.Now().Add(20 * time.Millisecond))
+
+	select {
+	case err := <-done:
+		if te, ok := err.(*timeoutError); !ok || !te.Timeout() {
+			t.Fatalf("want *timeoutError, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocked reserveWriteBuffer never observed the concurrently-set deadline")
+	}
+}
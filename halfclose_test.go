@@ -0,0 +1,57 @@
+package http2
+
+import "testing"
+
+// TestCloseReadMarksReadClosed covers CloseRead's bookkeeping: it must
+// flag the stream as locally read-closed (so deliverData starts
+// discarding inbound DATA) even when the peer has already half-closed
+// its own write side and no RST_STREAM needs to be sent.
+func TestCloseReadMarksReadClosed(t *testing.T) {
+	s := newTestStream(1, defaultWeight-1)
+	s.conn = &Conn{}
+	s.state = StateHalfClosedRemote
+
+	if s.readClosedByUs() {
+		t.Fatal("readClosedByUs() true before CloseRead was called")
+	}
+
+	if err := s.CloseRead(); err != nil {
+		t.Fatalf("CloseRead: %v", err)
+	}
+
+	if !s.readClosedByUs() {
+		t.Fatal("readClosedByUs() false after CloseRead")
+	}
+}
+
+// TestCloseReadClosedStreamIsNoop covers the other state in the same
+// no-reset case of CloseRead's state switch: a stream that's already
+// fully closed needs no RST_STREAM either.
+func TestCloseReadClosedStreamIsNoop(t *testing.T) {
+	s := newTestStream(1, defaultWeight-1)
+	s.conn = &Conn{}
+	s.state = StateClosed
+
+	if err := s.CloseRead(); err != nil {
+		t.Fatalf("CloseRead on already-closed stream: %v", err)
+	}
+	if !s.readClosedByUs() {
+		t.Fatal("readClosedByUs() false after CloseRead")
+	}
+}
+
+// TestCloseWriteIsIdempotent covers CloseWrite's contract that calling it
+// again after the stream has already seen its own end-of-stream (sawEOS)
+// is a no-op rather than an error surfaced to the caller.
+func TestCloseWriteIsIdempotent(t *testing.T) {
+	s := newTestStream(1, defaultWeight-1)
+	s.conn = &Conn{}
+	s.closeCh = make(chan struct{})
+	s.wio = make(chan struct{}, 1)
+	s.wio <- struct{}{}
+	s.sawEOS = true
+
+	if err := s.CloseWrite(); err != nil {
+		t.Fatalf("CloseWrite on a stream that already saw EOS: %v", err)
+	}
+}
@@ -0,0 +1,339 @@
+package http2
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Priority describes a stream's position in the per-connection dependency
+// tree, as carried by a PRIORITY frame or the priority fields of a HEADERS
+// frame (RFC 7540 Section 5.3).
+type Priority struct {
+	// StreamDep is the stream ID this stream depends on. Zero means the
+	// stream depends directly on the root of the tree.
+	StreamDep uint32
+
+	// Weight is a priority weight in the range [0, 255], stored as it is
+	// carried on the wire, i.e. the actual weight minus one; a freshly
+	// opened stream defaults to 15, i.e. the RFC's default weight of 16.
+	Weight uint8
+
+	// Exclusive marks this as an exclusive dependency: all of StreamDep's
+	// existing children are reparented under this stream. When StreamDep
+	// is zero, streams that depend directly on the root are not moved.
+	Exclusive bool
+}
+
+func defaultPriority() Priority {
+	return Priority{Weight: defaultWeight - 1}
+}
+
+// setPriority mutates s's position in the connection's dependency tree to
+// match priority, handling exclusive reparenting and rejecting cycles. It
+// is safe to call concurrently with frame processing and with other
+// streams' setPriority calls.
+func (s *stream) setPriority(priority Priority) error {
+	c := s.conn
+	c.priorityMu.Lock()
+	defer c.priorityMu.Unlock()
+
+	newParent := c.priorityNode(priority.StreamDep)
+	if newParent == s {
+		return StreamError{fmt.Errorf("stream %d cannot depend on itself", s.id), ErrCodeProtocol, s.id}
+	}
+	if newParent != nil && dependsOn(newParent, s) {
+		// The new parent is a descendant of s; per RFC 7540 5.3.3 the
+		// old dependent (newParent) takes s's former place in the tree.
+		oldParent := s.parent
+		s.detachFromParent()
+		newParent.detachFromParent()
+		newParent.attachTo(oldParent, false)
+	} else {
+		s.detachFromParent()
+	}
+
+	if priority.Exclusive && newParent != nil {
+		for _, child := range newParent.children {
+			child.detachFromParent()
+			child.attachTo(s, false)
+		}
+	}
+
+	s.weight = priority.Weight
+	s.attachTo(newParent, true)
+	return nil
+}
+
+// dependsOn reports whether s has ancestor somewhere in its chain of
+// parents, i.e. whether reparenting s under ancestor would form a cycle.
+func dependsOn(s, ancestor *stream) bool {
+	for p := s.parent; p != nil; p = p.parent {
+		if p == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *stream) detachFromParent() {
+	if s.parent == nil {
+		return
+	}
+	delete(s.parent.children, s.id)
+	s.parent = nil
+}
+
+// attachTo makes parent the new parent of s. parent == nil attaches s
+// directly to the root of the tree. If excludeSelf is set, s is skipped
+// when parent == s (used defensively by callers that already resolved
+// self-dependencies).
+func (s *stream) attachTo(parent *stream, excludeSelf bool) {
+	if excludeSelf && parent == s {
+		parent = nil
+	}
+	s.parent = parent
+	if parent == nil {
+		return
+	}
+	if parent.children == nil {
+		parent.children = make(map[uint32]*stream)
+	}
+	parent.children[s.id] = s
+}
+
+// priorityNode returns the stream acting as node id in the dependency
+// tree, creating a closed placeholder stream for it if id doesn't
+// correspond to a live stream (RFC 7540 Section 5.3.4). id == 0 returns
+// nil, representing the implicit root.
+func (c *Conn) priorityNode(id uint32) *stream {
+	if id == 0 {
+		return nil
+	}
+	if s, ok := c.streamByID(id); ok {
+		return s
+	}
+	placeholder := &stream{conn: c, id: id, state: StateClosed, weight: defaultWeight - 1}
+	c.addPriorityPlaceholder(placeholder)
+	return placeholder
+}
+
+// handlePriority processes an inbound PRIORITY frame, applying it to the
+// named stream (creating a placeholder for it too, if it doesn't exist
+// yet — a PRIORITY frame may arrive for a stream the peer hasn't opened).
+func (c *Conn) handlePriority(f *PriorityFrame) error {
+	s := c.priorityNode(f.StreamID)
+	if s == nil {
+		return ConnError{fmt.Errorf("PRIORITY frame for stream 0"), ErrCodeProtocol}
+	}
+	return s.setPriority(Priority{
+		StreamDep: f.StreamDep,
+		Weight:    f.Weight,
+		Exclusive: f.Exclusive,
+	})
+}
+
+// applyHeadersPriority applies the priority carried by an inbound
+// HEADERS frame to the stream it just opened. Most real clients set
+// priority this way rather than with a follow-up PRIORITY frame, so
+// this must run once per newly opened stream, alongside handlePriority
+// for standalone PRIORITY frames. When the frame didn't set the
+// PRIORITY fields, s gets the RFC's implicit default instead of being
+// left out of the tree.
+func (c *Conn) applyHeadersPriority(s *stream, f *HeadersFrame) error {
+	if !f.HasPriority {
+		return s.setPriority(defaultPriority())
+	}
+	return s.setPriority(f.Priority)
+}
+
+// reparentChildren moves s's children up to s's former parent, called
+// when s transitions to StateClosed so the tree doesn't orphan the
+// streams that were depending on it.
+func (s *stream) reparentChildren() {
+	parent := s.parent
+	for _, child := range s.children {
+		child.parent = nil
+		child.attachTo(parent, false)
+	}
+	s.children = nil
+}
+
+func (c *Conn) addPriorityPlaceholder(s *stream) {
+	if c.priorityPlaceholders == nil {
+		c.priorityPlaceholders = make(map[uint32]*stream)
+	}
+	c.priorityPlaceholders[s.id] = s
+}
+
+// streamByID is the general-purpose resolver frame dispatch should use
+// to map an inbound frame's stream ID to a *stream: PRIORITY,
+// WINDOW_UPDATE, and RST_STREAM can all legitimately target a stream
+// ID that no longer has a live entry in c.streams. Beyond the live
+// table and priority placeholders, it falls back to the recently-closed
+// LRU (closedstreams.go) so such frames still resolve to a *stream that
+// carries resetSent/resetReceived/closedAt -- letting transition apply
+// conn.ClosedStreamGrace and return ignoreFrame instead of killing the
+// connection.
+func (c *Conn) streamByID(id uint32) (*stream, bool) {
+	c.mu.Lock()
+	s, ok := c.streams[id]
+	if !ok {
+		s, ok = c.priorityPlaceholders[id]
+	}
+	c.mu.Unlock()
+	if ok {
+		return s, true
+	}
+	return c.closedStream(id)
+}
+
+// writeQueue implements a weighted fair scheduler over the connection's
+// stream dependency tree (RFC 7540 Section 5.3.2): at each node with
+// pending children, writable bytes are distributed among them in
+// proportion to weight+1. HEADERS and RST_STREAM frames bypass the tree
+// and are written ahead of any DATA frame scheduling.
+type writeQueue struct {
+	mu      sync.Mutex
+	conn    *Conn
+	bypass  []*stream
+	pending map[uint32]*stream
+	signal  chan struct{}
+}
+
+func newWriteQueue(c *Conn) *writeQueue {
+	return &writeQueue{
+		conn:    c,
+		pending: make(map[uint32]*stream),
+		signal:  make(chan struct{}, 1),
+	}
+}
+
+// add enqueues s to be written. bypass streams (HEADERS, RST_STREAM) run
+// ahead of the weighted DATA schedule in FIFO order.
+func (q *writeQueue) add(s *stream, bypass bool) {
+	q.mu.Lock()
+	if bypass {
+		q.bypass = append(q.bypass, s)
+	} else {
+		q.pending[s.id] = s
+	}
+	q.mu.Unlock()
+
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// next selects the next stream to write to, blocking until one is
+// available or closeCh is closed.
+func (q *writeQueue) next(closeCh <-chan struct{}) (*stream, bool) {
+	for {
+		if s, ok := q.pop(); ok {
+			return s, true
+		}
+		select {
+		case <-q.signal:
+		case <-closeCh:
+			return nil, false
+		}
+	}
+}
+
+func (q *writeQueue) pop() (*stream, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.bypass) > 0 {
+		s := q.bypass[0]
+		q.bypass = q.bypass[1:]
+		return s, true
+	}
+
+	// scheduleFromRoot reads and mutates the dependency tree (children
+	// maps, schedVTime) that setPriority and close()'s reparenting also
+	// mutate; both must go through the same lock or a stream closing on
+	// the reader goroutine races with scheduling on the writer goroutine.
+	q.conn.priorityMu.Lock()
+	s := q.conn.scheduleFromRoot(q.pending)
+	q.conn.priorityMu.Unlock()
+
+	if s != nil {
+		delete(q.pending, s.id)
+	}
+	return s, s != nil
+}
+
+// scheduleFromRoot picks the next stream to write using deficit-weighted
+// fair queueing over the dependency tree. Each stream carries a
+// schedVTime ("how many weighted bytes it has already been scheduled"),
+// and at every level of the tree the sibling with the least schedVTime
+// is preferred; schedVTime is only advanced for the branch actually
+// picked, by frameBytes/(weight+1). Because state persists across calls,
+// repeated picks interleave in proportion to weight instead of always
+// favoring whichever sibling looked best in isolation on this one call.
+func (c *Conn) scheduleFromRoot(pending map[uint32]*stream) *stream {
+	topLevel := make(map[uint32]*stream)
+	for _, s := range pending {
+		root := s
+		for root.parent != nil {
+			root = root.parent
+		}
+		topLevel[root.id] = root
+	}
+
+	leaf, branch, ok := pickChild(topLevel, pending)
+	if !ok {
+		return nil
+	}
+
+	size := frameBytes(leaf.Frame)
+	if size <= 0 {
+		size = 1
+	}
+	for n := leaf; n != nil; n = n.parent {
+		n.schedVTime += float64(size) / float64(int(n.weight)+1)
+		if n == branch {
+			break
+		}
+	}
+	return leaf
+}
+
+// pickChild selects, among siblings, the one with the least schedVTime
+// that either is itself pending or has a pending stream somewhere in its
+// subtree. It returns the leaf stream to actually schedule, along with
+// branch, the direct member of siblings the choice descended through
+// (whose schedVTime -- and that of every node between it and leaf --
+// scheduleFromRoot advances).
+func pickChild(siblings map[uint32]*stream, pending map[uint32]*stream) (leaf, branch *stream, ok bool) {
+	first := true
+	var bestVTime float64
+	for _, child := range siblings {
+		var candidate *stream
+		if _, isPending := pending[child.id]; isPending {
+			candidate = child
+		} else {
+			var found bool
+			candidate, _, found = pickChild(child.children, pending)
+			if !found {
+				continue
+			}
+		}
+
+		if first || child.schedVTime < bestVTime {
+			leaf, branch, bestVTime, first = candidate, child, child.schedVTime, false
+		}
+	}
+	return leaf, branch, !first
+}
+
+// frameBytes returns the on-wire payload size of f that should count
+// against its stream's fair share, or 0 for frame types (or an empty
+// END_STREAM DATA frame) that don't meaningfully consume bandwidth.
+func frameBytes(f Frame) int {
+	if d, ok := f.(*DataFrame); ok {
+		return d.DataLen + int(d.PadLen)
+	}
+	return 0
+}
@@ -0,0 +1,154 @@
+package http2
+
+import "testing"
+
+func newTestStream(id uint32, weight uint8) *stream {
+	return &stream{id: id, weight: weight}
+}
+
+// TestPriorityEqualWeightSiblings covers the RFC 7540 5.3.2 example of
+// A<-B,C: B and C both depend on A with equal weight, so they should be
+// siblings of each other and children of A.
+func TestPriorityEqualWeightSiblings(t *testing.T) {
+	conn := &Conn{}
+	a := newTestStream(1, defaultWeight-1)
+	b := newTestStream(3, defaultWeight-1)
+	c := newTestStream(5, defaultWeight-1)
+	a.conn, b.conn, c.conn = conn, conn, conn
+	conn.streams = map[uint32]*stream{1: a, 3: b, 5: c}
+
+	if err := b.setPriority(Priority{StreamDep: 1, Weight: defaultWeight - 1}); err != nil {
+		t.Fatalf("b.setPriority: %v", err)
+	}
+	if err := c.setPriority(Priority{StreamDep: 1, Weight: defaultWeight - 1}); err != nil {
+		t.Fatalf("c.setPriority: %v", err)
+	}
+
+	if b.parent != a || c.parent != a {
+		t.Fatalf("expected B and C to depend on A, got b.parent=%v c.parent=%v", b.parent, c.parent)
+	}
+	if len(a.children) != 2 {
+		t.Fatalf("expected A to have 2 children, got %d", len(a.children))
+	}
+}
+
+// TestPriorityExclusiveReprioritization covers RFC 7540 5.3.1's exclusive
+// flag: when D becomes an exclusive child of A, A's existing children
+// (B, C) must be reparented underneath D.
+func TestPriorityExclusiveReprioritization(t *testing.T) {
+	conn := &Conn{}
+	a := newTestStream(1, defaultWeight-1)
+	b := newTestStream(3, defaultWeight-1)
+	c := newTestStream(5, defaultWeight-1)
+	d := newTestStream(7, defaultWeight-1)
+	for _, s := range []*stream{a, b, c, d} {
+		s.conn = conn
+	}
+	conn.streams = map[uint32]*stream{1: a, 3: b, 5: c, 7: d}
+
+	b.attachTo(a, false)
+	c.attachTo(a, false)
+
+	if err := d.setPriority(Priority{StreamDep: 1, Weight: defaultWeight - 1, Exclusive: true}); err != nil {
+		t.Fatalf("d.setPriority: %v", err)
+	}
+
+	if d.parent != a {
+		t.Fatalf("expected D to depend on A, got %v", d.parent)
+	}
+	if b.parent != d || c.parent != d {
+		t.Fatalf("expected B and C reparented under D, got b.parent=%v c.parent=%v", b.parent, c.parent)
+	}
+	if len(d.children) != 2 {
+		t.Fatalf("expected D to have 2 children after exclusive reprioritization, got %d", len(d.children))
+	}
+}
+
+// TestPriorityClosedParentReparenting covers close()'s handling of the
+// dependency tree: closing A should move its children (B, C) up to A's
+// own parent rather than orphaning them.
+func TestPriorityClosedParentReparenting(t *testing.T) {
+	conn := &Conn{}
+	root := newTestStream(1, defaultWeight-1)
+	a := newTestStream(3, defaultWeight-1)
+	b := newTestStream(5, defaultWeight-1)
+	c := newTestStream(7, defaultWeight-1)
+	for _, s := range []*stream{root, a, b, c} {
+		s.conn = conn
+	}
+
+	a.attachTo(root, false)
+	b.attachTo(a, false)
+	c.attachTo(a, false)
+
+	a.reparentChildren()
+	a.detachFromParent()
+
+	if b.parent != root || c.parent != root {
+		t.Fatalf("expected B and C reparented under root, got b.parent=%v c.parent=%v", b.parent, c.parent)
+	}
+	if len(root.children) != 2 {
+		t.Fatalf("expected root to have 2 children after reparenting, got %d", len(root.children))
+	}
+	if len(a.children) != 0 {
+		t.Fatalf("expected A to have no children left, got %d", len(a.children))
+	}
+}
+
+// TestScheduleEqualWeightsInterleave covers the A<-B,C equal-weights case
+// for the write scheduler itself: with both siblings permanently
+// pending, repeated picks should interleave roughly 50/50, not be biased
+// by map iteration order.
+func TestScheduleEqualWeightsInterleave(t *testing.T) {
+	conn := &Conn{}
+	b := newTestStream(3, defaultWeight-1)
+	c := newTestStream(5, defaultWeight-1)
+	b.conn, c.conn = conn, conn
+	b.Frame = &DataFrame{DataLen: 100}
+	c.Frame = &DataFrame{DataLen: 100}
+
+	counts := map[uint32]int{}
+	const rounds = 1000
+	for i := 0; i < rounds; i++ {
+		pending := map[uint32]*stream{b.id: b, c.id: c}
+		picked := conn.scheduleFromRoot(pending)
+		if picked == nil {
+			t.Fatal("expected a stream to be scheduled")
+		}
+		counts[picked.id]++
+	}
+
+	for id, n := range counts {
+		if n < rounds*35/100 || n > rounds*65/100 {
+			t.Fatalf("stream %d picked %d/%d times, want roughly even split", id, n, rounds)
+		}
+	}
+}
+
+// TestScheduleWeightedNoStarvation covers the RFC's proportional-share
+// intent for unequal weights: a heavily-weighted stream should be picked
+// far more often than a lightly-weighted one, but the lightly-weighted
+// one must never be fully starved across many rounds.
+func TestScheduleWeightedNoStarvation(t *testing.T) {
+	conn := &Conn{}
+	heavy := newTestStream(3, 100)
+	light := newTestStream(5, 1)
+	heavy.conn, light.conn = conn, conn
+	heavy.Frame = &DataFrame{DataLen: 100}
+	light.Frame = &DataFrame{DataLen: 100}
+
+	counts := map[uint32]int{}
+	const rounds = 1000
+	for i := 0; i < rounds; i++ {
+		pending := map[uint32]*stream{heavy.id: heavy, light.id: light}
+		picked := conn.scheduleFromRoot(pending)
+		counts[picked.id]++
+	}
+
+	if counts[light.id] == 0 {
+		t.Fatalf("light stream was starved entirely: counts=%v", counts)
+	}
+	if counts[heavy.id] <= counts[light.id] {
+		t.Fatalf("expected heavy stream to be picked far more often: counts=%v", counts)
+	}
+}
@@ -0,0 +1,91 @@
+package http2
+
+import "io"
+
+// recvPipe returns the channel inbound DATA payloads are delivered on,
+// initializing it on first use.
+func (s *stream) recvPipe() chan []byte {
+	s.recvOnce.Do(func() {
+		s.recvMu.Lock()
+		s.recvCh = make(chan []byte, 4)
+		s.recvMu.Unlock()
+	})
+	return s.recvCh
+}
+
+// deliverData is the frame reader's hook for handing a DATA payload to
+// the stream's reader. It must be called after the payload has already
+// been accounted against the stream's recvFlow window. If CloseRead has
+// been called locally, the payload is silently discarded -- the caller
+// is still responsible for the flow-control accounting, CloseRead only
+// affects whether bytes reach Read.
+func (s *stream) deliverData(data []byte, endStream bool) {
+	if s.readClosedByUs() {
+		if endStream {
+			s.closeRecvPipe()
+		}
+		return
+	}
+
+	ch := s.recvPipe()
+	if len(data) > 0 {
+		select {
+		case ch <- data:
+		case <-s.closeCh:
+			return
+		case <-s.conn.closeCh:
+			return
+		}
+	}
+	if endStream {
+		s.closeRecvPipe()
+	}
+}
+
+func (s *stream) closeRecvPipe() {
+	ch := s.recvPipe()
+
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	if !s.recvEOF {
+		s.recvEOF = true
+		close(ch)
+	}
+}
+
+// Read reads from the stream's inbound DATA pipe, honoring the deadline
+// set by SetReadDeadline/SetDeadline: if the deadline elapses before any
+// data (or end-of-stream) arrives, Read returns a *timeoutError without
+// affecting the stream's state, exactly as write does on the write side.
+// The deadline is re-read whenever it changes, so a concurrent
+// SetReadDeadline applies to a Read already blocked, not just the next
+// call.
+func (s *stream) Read(p []byte) (int, error) {
+	for len(s.recvBuf) == 0 {
+		if s.readClosedByUs() {
+			return 0, io.EOF
+		}
+
+		timeoutCh, changedCh := s.readWaitChans()
+		select {
+		case chunk, ok := <-s.recvPipe():
+			if !ok {
+				return 0, io.EOF
+			}
+			s.recvBuf = chunk
+		case <-timeoutCh:
+			return 0, &timeoutError{}
+		case <-changedCh:
+			// Deadline changed while we were waiting; loop and
+			// re-evaluate against the new one.
+		case <-s.closeCh:
+			return 0, io.EOF
+		case <-s.conn.closeCh:
+			return 0, ErrClosed
+		}
+	}
+
+	n := copy(p, s.recvBuf)
+	s.recvBuf = s.recvBuf[n:]
+	return n, nil
+}
@@ -3,7 +3,9 @@ package http2
 import (
 	"errors"
 	"fmt"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type StreamState int32
@@ -30,6 +32,10 @@ type stream struct {
 	parent   *stream
 	children map[uint32]*stream
 
+	// schedVTime is the weighted-fair-queueing scheduler's bookkeeping
+	// for this stream; see (*Conn).scheduleFromRoot in priority.go.
+	schedVTime float64
+
 	recvFlow *flowController
 	sendFlow *remoteFlowController
 
@@ -40,9 +46,36 @@ type stream struct {
 	resetSent,
 	resetReceived bool
 
+	// readClosed is set by CloseRead once the caller has given up on the
+	// read side; inbound DATA is then discarded (after flow-control
+	// accounting) instead of being delivered.
+	readClosed int32
+
 	wio     chan struct{}
 	werr    chan error
 	closeCh chan struct{}
+
+	deadlineMu     sync.Mutex
+	writeTimer     *time.Timer
+	writeTimerCh   chan struct{}
+	writeChangedCh chan struct{}
+	readTimer      *time.Timer
+	readTimerCh    chan struct{}
+	readChangedCh  chan struct{}
+
+	recvMu   sync.Mutex
+	recvCh   chan []byte
+	recvBuf  []byte
+	recvEOF  bool
+	recvOnce sync.Once
+
+	writeBufMu     sync.Mutex
+	writeBufLen    int
+	writeBufSignal chan struct{}
+
+	// closedAt is the UnixNano time at which the stream reached
+	// StateClosed, used to honor conn.ClosedStreamGrace in transition.
+	closedAt int64
 }
 
 func (s *stream) active() bool {
@@ -74,88 +107,139 @@ func (s *stream) writable() bool {
 
 var errStreamClosed = errors.New("stream closed")
 
-func (s *stream) write(frame Frame) error {
-	select {
-	case <-s.conn.closeCh:
-		return ErrClosed
-	case <-s.closeCh:
-		return errStreamClosed
-	case <-s.wio:
-		defer func() { s.wio <- struct{}{} }()
+// ignoreFrame is returned by transition for frames that RFC 7540
+// permits a peer to send on a stream that only just closed on our side;
+// the frame reader loop treats it as a no-op rather than a connection
+// or stream error. It is also returned, with no grace-window check, when
+// we try to send a RST_STREAM on a stream that is already closed.
+var ignoreFrame = errors.New("http2: ignoring frame for recently closed stream")
+
+// withinClosedGrace reports whether s closed recently enough that
+// certain frames arriving for it should be tolerated rather than
+// treated as errors, per conn.ClosedStreamGrace.
+func (s *stream) withinClosedGrace() bool {
+	closedAt := atomic.LoadInt64(&s.closedAt)
+	if closedAt == 0 {
+		return false
+	}
+	return time.Since(time.Unix(0, closedAt)) <= s.conn.closedStreamGrace()
+}
 
-		if s.sawEOS {
+// acquireWio waits for exclusive access to the stream's write path,
+// respecting the write deadline; a concurrent SetWriteDeadline wakes
+// this up immediately to re-check rather than only affecting the next
+// call.
+func (s *stream) acquireWio() error {
+	for {
+		timeoutCh, changedCh := s.writeWaitChans()
+		select {
+		case <-s.conn.closeCh:
+			return ErrClosed
+		case <-s.closeCh:
 			return errStreamClosed
+		case <-timeoutCh:
+			return &timeoutError{}
+		case <-changedCh:
+			// Deadline changed while we were waiting; loop and
+			// re-evaluate against the new one.
+		case <-s.wio:
+			return nil
 		}
+	}
+}
 
-		if frame.Type() == FrameHeaders {
-			s.Frame = frame
-			s.conn.writeQueue.add(s, false)
-			return <-s.werr
-		}
-
-		data, ok := frame.(*DataFrame)
-		if !ok {
-			return fmt.Errorf("bad flow control frame type %s", frame.Type())
-		}
+func (s *stream) write(frame Frame) error {
+	if err := s.acquireWio(); err != nil {
+		return err
+	}
+	defer func() { s.wio <- struct{}{} }()
 
-		dataLen := data.DataLen
-		padLen := int(data.PadLen)
-		allowed, err := allocateBytes(s, dataLen+padLen)
-		if err != nil {
-			return err
-		}
+	if s.sawEOS {
+		return errStreamClosed
+	}
 
-		if allowed == dataLen+padLen {
-			s.Frame = frame
-			s.conn.writeQueue.add(s, false)
-			return <-s.werr
-		}
+	if frame.Type() == FrameHeaders {
+		s.Frame = frame
+		s.conn.writeQueue.add(s, true)
+		return s.waitWerr()
+	}
 
-		chunk := new(DataFrame)
-		*chunk = *data
-		s.Frame = chunk
+	data, ok := frame.(*DataFrame)
+	if !ok {
+		return fmt.Errorf("bad flow control frame type %s", frame.Type())
+	}
 
-		lastFrame := false
-		padding := 0
+	dataLen := data.DataLen
+	padLen := int(data.PadLen)
+	allowed, err := allocateBytes(s, dataLen+padLen)
+	if err != nil {
+		return err
+	}
 
-	again:
-		chunk.DataLen = dataLen
-		if chunk.DataLen > allowed {
-			chunk.DataLen = allowed
+	if allowed == dataLen+padLen {
+		if err := s.reserveWriteBuffer(allowed); err != nil {
+			return err
 		}
+		s.Frame = frame
+		s.conn.writeQueue.add(s, false)
+		return s.waitWerr()
+	}
 
-		padding = allowed - chunk.DataLen
-		if padding > padLen {
-			padding = padLen
-		}
+	chunk := new(DataFrame)
+	*chunk = *data
+	s.Frame = chunk
 
-		dataLen -= chunk.DataLen
-		padLen -= padding
-		lastFrame = dataLen+padLen == 0
+	lastFrame := false
+	padding := 0
 
-		chunk.PadLen = uint8(padding)
-		chunk.EndStream = data.EndStream && lastFrame
+again:
+	chunk.DataLen = dataLen
+	if chunk.DataLen > allowed {
+		chunk.DataLen = allowed
+	}
 
-		s.conn.writeQueue.add(s, false)
-		err = <-s.werr
+	padding = allowed - chunk.DataLen
+	if padding > padLen {
+		padding = padLen
+	}
 
-		if lastFrame || err != nil {
-			return err
-		}
+	dataLen -= chunk.DataLen
+	padLen -= padding
+	lastFrame = dataLen+padLen == 0
 
-		allowed, err = allocateBytes(s, dataLen+padLen)
-		if err != nil {
-			return err
-		}
+	chunk.PadLen = uint8(padding)
+	chunk.EndStream = data.EndStream && lastFrame
 
-		goto again
+	if err := s.reserveWriteBuffer(allowed); err != nil {
+		return err
 	}
+	s.conn.writeQueue.add(s, false)
+	err = s.waitWerr()
+
+	if lastFrame || err != nil {
+		return err
+	}
+
+	allowed, err = allocateBytes(s, dataLen+padLen)
+	if err != nil {
+		return err
+	}
+
+	goto again
 }
 
 func (s *stream) writeTo(w *frameWriter) error {
 	err := s.Frame.(frameWriterTo).writeTo(w)
 	s.lastWritten = s.Frame.Type()
 	s.sawEOS = s.Frame.EndOfStream()
+	if data, ok := s.Frame.(*DataFrame); ok {
+		// The reservation write() made in reserveWriteBuffer is only
+		// freed here, once the frame has actually left conn.writeQueue,
+		// not when waitWerr returns -- a write deadline firing while
+		// this frame is still queued must not let a retried write pile
+		// more bytes on top of ones that are still pinned.
+		s.releaseWriteBuffer(data.DataLen + int(data.PadLen))
+	}
 	s.werr <- err
 	if s.sawEOS && err == nil {
 		_, err = s.transition(false, s.lastWritten, true)
@@ -184,8 +268,45 @@ func (s *stream) local() bool {
 	return s.conn.server == ((s.id & 1) == 0)
 }
 
-func (s *stream) setPriority(priority Priority) error {
-	return nil
+// CloseWrite half-closes the write side of the stream: it sends an
+// END_STREAM-flagged frame (an empty DATA frame, since there's nothing
+// buffered to tag it onto) and drives the state machine towards
+// StateHalfClosedLocal or StateClosed. Subsequent writes return
+// errStreamClosed. CloseWrite is idempotent.
+func (s *stream) CloseWrite() error {
+	err := s.write(&DataFrame{EndStream: true})
+	if err == errStreamClosed {
+		return nil
+	}
+	return err
+}
+
+// CloseRead half-closes the read side of the stream. If the peer hasn't
+// already half-closed its write side, a RST_STREAM with CANCEL is sent
+// to tell it to stop; otherwise the peer is already done and no reset is
+// needed. Either way, further inbound DATA is discarded rather than
+// delivered to the reader, though it still counts against (and returns)
+// the receive-flow window so the peer's WINDOW_UPDATE accounting stays
+// correct.
+func (s *stream) CloseRead() error {
+	atomic.StoreInt32(&s.readClosed, 1)
+
+	if s.recvFlow != nil {
+		s.recvFlow.returnBytes(s.recvFlow.consumedBytes())
+	}
+
+	switch StreamState(atomic.LoadInt32((*int32)(&s.state))) {
+	case StateHalfClosedRemote, StateClosed:
+		return nil
+	}
+	return s.conn.sendRSTStream(s, ErrCodeCancel)
+}
+
+// readClosedByUs reports whether CloseRead has been called locally, in
+// which case inbound DATA should be discarded after flow-control
+// accounting rather than delivered.
+func (s *stream) readClosedByUs() bool {
+	return atomic.LoadInt32(&s.readClosed) != 0
 }
 
 func (s *stream) compareAndSwapState(from, to StreamState) bool {
@@ -205,7 +326,11 @@ func (s *stream) compareAndSwapState(from, to StreamState) bool {
 				}
 
 				w := int(s.conn.Settings().InitialWindowSize())
-				s.recvFlow = &flowController{s: s, win: w, winUpperBound: w, processedWin: w}
+				upperBound := w
+				if rb := s.conn.streamReadBufferSize(); rb > 0 && rb < upperBound {
+					upperBound = rb
+				}
+				s.recvFlow = &flowController{s: s, win: w, winUpperBound: upperBound, processedWin: w}
 
 				if to != StateHalfClosedLocal {
 					w = int(s.conn.RemoteSettings().InitialWindowSize())
@@ -235,6 +360,8 @@ func (s *stream) compareAndSwapState(from, to StreamState) bool {
 
 			if from != StateClosed {
 				close(s.closeCh)
+				atomic.StoreInt64(&s.closedAt, time.Now().UnixNano())
+				s.conn.rememberClosed(s)
 
 				s.cancel(errStreamClosed)
 				if s.sendFlow != nil {
@@ -245,6 +372,11 @@ func (s *stream) compareAndSwapState(from, to StreamState) bool {
 					s.recvFlow.returnBytes(s.recvFlow.consumedBytes())
 				}
 
+				s.conn.priorityMu.Lock()
+				s.reparentChildren()
+				s.detachFromParent()
+				s.conn.priorityMu.Unlock()
+
 				s.conn.removeStream(s)
 			}
 		}
@@ -261,10 +393,9 @@ func (s *stream) transition(recv bool, frameType FrameType, endStream bool) (Str
 		if !ok {
 			if !recv {
 				if from == StateClosed {
-
-					// if frameType == FrameRSTStream {
-					// 	return from, ignoreFrame
-					// }
+					if frameType == FrameRSTStream {
+						return from, ignoreFrame
+					}
 
 					// An endpoint MUST NOT send frames other than PRIORITY on a closed stream.
 					return from, fmt.Errorf("stream %d already closed", s.id)
@@ -284,10 +415,9 @@ func (s *stream) transition(recv bool, frameType FrameType, endStream bool) (Str
 				// receives on closed streams after it has sent a RST_STREAM frame.
 				// An endpoint MAY choose to limit the period over which it ignores
 				// frames and treat frames that arrive after this time as being in error.
-
-				// if time.Since(s.closed) <= time.Duration(5)*time.Second {
-				// 	return from, ignoreFrame
-				// }
+				if s.withinClosedGrace() {
+					return from, ignoreFrame
+				}
 
 				return from, StreamError{fmt.Errorf("stream %d already closed", s.id), ErrCodeStreamClosed, s.id}
 			}
@@ -310,10 +440,9 @@ func (s *stream) transition(recv bool, frameType FrameType, endStream bool) (Str
 				// (Section 5.4.1) of type PROTOCOL_ERROR.
 				switch frameType {
 				case FrameRSTStream, FrameWindowUpdate:
-
-					// if time.Since(s.closed) <= time.Duration(5)*time.Second {
-					// 	return from, ignoreFrame
-					// }
+					if s.withinClosedGrace() {
+						return from, ignoreFrame
+					}
 
 					return from, ConnError{fmt.Errorf("stream %d already closed", s.id), ErrCodeProtocol}
 				}
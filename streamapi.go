@@ -0,0 +1,57 @@
+package http2
+
+import "time"
+
+// Stream is the user-facing handle for an HTTP/2 stream, wrapping the
+// package-private stream implementation.
+type Stream struct {
+	s *stream
+}
+
+// Read reads from the stream's inbound DATA, honoring any deadline set
+// by SetReadDeadline/SetDeadline; see (*stream).Read.
+func (st Stream) Read(p []byte) (int, error) {
+	return st.s.Read(p)
+}
+
+// CloseWrite half-closes the write side of the stream; see
+// (*stream).CloseWrite.
+func (st Stream) CloseWrite() error {
+	return st.s.CloseWrite()
+}
+
+// CloseRead half-closes the read side of the stream; see
+// (*stream).CloseRead.
+func (st Stream) CloseRead() error {
+	return st.s.CloseRead()
+}
+
+// SetReadDeadline sets the deadline for future reads; see
+// (*stream).SetReadDeadline.
+func (st Stream) SetReadDeadline(t time.Time) error {
+	return st.s.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for future writes; see
+// (*stream).SetWriteDeadline.
+func (st Stream) SetWriteDeadline(t time.Time) error {
+	return st.s.SetWriteDeadline(t)
+}
+
+// SetDeadline sets both the read and write deadlines; see
+// (*stream).SetDeadline.
+func (st Stream) SetDeadline(t time.Time) error {
+	return st.s.SetDeadline(t)
+}
+
+// BufferedWriteLen reports how many bytes of outbound DATA are
+// currently buffered for this stream; see (*stream).BufferedWriteLen.
+func (st Stream) BufferedWriteLen() int {
+	return st.s.BufferedWriteLen()
+}
+
+// BufferedReadLen reports how many bytes of inbound DATA have been
+// received but not yet consumed; see (*stream).BufferedReadLen.
+func (st Stream) BufferedReadLen() int {
+	return st.s.BufferedReadLen()
+}
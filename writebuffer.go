@@ -0,0 +1,99 @@
+package http2
+
+// defaultStreamWriteBufferSize bounds, per stream, how many bytes of
+// outbound DATA may be sitting in conn.writeQueue plus the current
+// in-flight DataFrame before write blocks for the buffer to drain. It
+// mirrors the default used by golang.org/x/net/quic.
+const defaultStreamWriteBufferSize = 1 << 20 // 1 MiB
+
+// streamWriteBufferSize returns the configured per-stream write buffer
+// size, or defaultStreamWriteBufferSize if the connection wasn't
+// configured with one.
+func (c *Conn) streamWriteBufferSize() int {
+	if c.StreamWriteBufferSize > 0 {
+		return c.StreamWriteBufferSize
+	}
+	return defaultStreamWriteBufferSize
+}
+
+// streamReadBufferSize returns the configured ceiling on a stream's
+// advertised receive window, or 0 if uncapped (i.e. bounded only by the
+// connection-wide InitialWindowSize).
+func (c *Conn) streamReadBufferSize() int {
+	return c.StreamReadBufferSize
+}
+
+func (s *stream) writeBufSignalChan() chan struct{} {
+	s.writeBufMu.Lock()
+	defer s.writeBufMu.Unlock()
+	if s.writeBufSignal == nil {
+		s.writeBufSignal = make(chan struct{}, 1)
+	}
+	return s.writeBufSignal
+}
+
+// reserveWriteBuffer blocks, respecting the write deadline and the
+// stream/conn close channels, until n bytes are available in the
+// stream's write buffer, then reserves them. It always admits a write
+// into an empty buffer even if n alone exceeds the limit, so a single
+// oversized frame can't deadlock the stream. The deadline is re-read on
+// every iteration, so a concurrent SetWriteDeadline applies to an
+// already-blocked reservation, not just the next call.
+func (s *stream) reserveWriteBuffer(n int) error {
+	limit := s.conn.streamWriteBufferSize()
+	signal := s.writeBufSignalChan()
+
+	for {
+		s.writeBufMu.Lock()
+		if s.writeBufLen == 0 || s.writeBufLen+n <= limit {
+			s.writeBufLen += n
+			s.writeBufMu.Unlock()
+			return nil
+		}
+		s.writeBufMu.Unlock()
+
+		timeoutCh, changedCh := s.writeWaitChans()
+		select {
+		case <-signal:
+		case <-timeoutCh:
+			return &timeoutError{}
+		case <-changedCh:
+			// Deadline changed while we were waiting; loop and
+			// re-evaluate against the new one.
+		case <-s.closeCh:
+			return errStreamClosed
+		case <-s.conn.closeCh:
+			return ErrClosed
+		}
+	}
+}
+
+// releaseWriteBuffer returns n bytes to the stream's write buffer and
+// wakes up any write blocked in reserveWriteBuffer.
+func (s *stream) releaseWriteBuffer(n int) {
+	s.writeBufMu.Lock()
+	s.writeBufLen -= n
+	s.writeBufMu.Unlock()
+
+	select {
+	case s.writeBufSignalChan() <- struct{}{}:
+	default:
+	}
+}
+
+// BufferedWriteLen reports how many bytes of outbound DATA are currently
+// buffered for this stream (queued plus in-flight).
+func (s *stream) BufferedWriteLen() int {
+	s.writeBufMu.Lock()
+	defer s.writeBufMu.Unlock()
+	return s.writeBufLen
+}
+
+// BufferedReadLen reports how many bytes of inbound DATA have been
+// received but not yet consumed by the reader.
+func (s *stream) BufferedReadLen() int {
+	if s.recvFlow == nil {
+		return 0
+	}
+	return s.recvFlow.consumedBytes()
+}
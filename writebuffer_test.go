@@ -0,0 +1,42 @@
+package http2
+
+import (
+	"testing"
+	"time"
+)
+
+// TestReleaseWriteBufferOnlyAfterActualDrain is the regression the
+// maintainer asked for: a write deadline firing while a DataFrame is
+// still queued (writeTo hasn't run) must not free its reservation, or a
+// caller retrying after each timeout could pile up more than
+// StreamWriteBufferSize bytes of real, still-queued data.
+func TestReleaseWriteBufferOnlyAfterActualDrain(t *testing.T) {
+	s := newTestStream(1, defaultWeight-1)
+	s.conn = &Conn{closeCh: make(chan struct{}), StreamWriteBufferSize: 100}
+	s.closeCh = make(chan struct{})
+
+	if err := s.reserveWriteBuffer(100); err != nil {
+		t.Fatalf("first reserveWriteBuffer: %v", err)
+	}
+
+	// Simulate write()'s deadline firing before writeTo has drained the
+	// frame: a second reservation attempt must block, then time out,
+	// rather than being admitted because the first one was released too
+	// early.
+	s.SetWriteDeadline(time.Now().Add(20 * time.Millisecond))
+	err := s.reserveWriteBuffer(1)
+	if te, ok := err.(*timeoutError); !ok || !te.Timeout() {
+		t.Fatalf("second reserveWriteBuffer: want *timeoutError (buffer still full), got %v", err)
+	}
+
+	if got := s.BufferedWriteLen(); got != 100 {
+		t.Fatalf("BufferedWriteLen() = %d after timeout, want 100 (first reservation must still be held)", got)
+	}
+
+	// Only once the frame actually leaves the queue (writeTo calling
+	// releaseWriteBuffer) does the space become available again.
+	s.releaseWriteBuffer(100)
+	if got := s.BufferedWriteLen(); got != 0 {
+		t.Fatalf("BufferedWriteLen() = %d after real drain, want 0", got)
+	}
+}